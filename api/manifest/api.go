@@ -7,82 +7,259 @@
 package manifest
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"regexp"
 	"time"
 
 	"github.com/google/go-github/v47/github"
 	"github.com/web-platform-tests/wpt.fyi/shared"
+	"golang.org/x/sync/singleflight"
 )
 
 // AssetRegex is the pattern for a valid manifest filename.
 // The full sha is captured in group 1.
 var AssetRegex = regexp.MustCompile(`^MANIFEST-([0-9a-fA-F]{40}).json.gz$`)
 
+// manifestCacheExpiry is how long a manifest (GitHub-sourced or directly ingested) is kept in
+// the shared Redis cache.
+const manifestCacheExpiry = 48 * time.Hour
+
+// shaRegex matches a full, lowercase-or-uppercase git SHA, as embedded in a manifest asset name.
+var shaRegex = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
 // API handles manifest-related fetches and caching.
 type API interface {
 	GetManifestForSHA(string) (string, []byte, error)
+	// GetManifestForSHAFromRepo behaves like GetManifestForSHA, but looks up the release in the
+	// given owner/repo instead of shared.WPTRepoOwner/shared.WPTRepoName, so a fork or vendor
+	// staging repo that publishes manifests the same way upstream wpt does can be fetched and
+	// cached. This is storage/lookup support only: the checks pipeline (loadRunsToCompare,
+	// shared.TestRunFilter) doesn't yet carry a repo identifier alongside SHAs, so nothing can
+	// drive a cross-repo comparison through it yet. That plumbing is open follow-up work, not
+	// done here.
+	GetManifestForSHAFromRepo(owner, repo, sha string) (string, []byte, error)
+	// GetCompatibleManifestForSHA behaves like GetManifestForSHA, but only returns a manifest
+	// whose release metadata declares a schema version within [minSchema, maxSchema]. If the
+	// SHA's own release isn't compatible, it walks recent releases for the latest one that is,
+	// and returns ErrNoCompatibleManifest if none are found.
+	GetCompatibleManifestForSHA(sha string, minSchema, maxSchema int) (string, []byte, error)
+	// IngestManifest stores a pre-fetched, gzipped MANIFEST-{sha}.json.gz directly, without
+	// fetching it from a GitHub release. A wpt manifest's JSON body doesn't embed the commit SHA
+	// it was generated for, so sha is trusted from the caller, which is gated by the upload
+	// bearer token (see HandleUpload).
+	IngestManifest(sha string, gzBytes []byte) error
+	// IngestManifestForRepo behaves like IngestManifest, but stores the manifest under the cache
+	// key for the given owner/repo, so a subsequent GetManifestForSHAFromRepo(owner, repo, sha)
+	// call for a fork/branch can find it.
+	IngestManifestForRepo(owner, repo, sha string, gzBytes []byte) error
 	NewRedis(duration time.Duration) shared.ReadWritable
 }
 
 type apiImpl struct {
-	ctx context.Context
+	ctx         context.Context
+	retryPolicy RetryPolicy
+}
+
+// fetchGroup coalesces concurrent GetManifestForSHAFromRepo (and so GetManifestForSHA) calls for
+// the same owner/repo/SHA into a single GitHub release lookup + download, across all apiImpl
+// instances in this process.
+var fetchGroup singleflight.Group
+
+// APIOption configures an API returned by NewAPI.
+type APIOption func(*apiImpl)
+
+// WithRetryPolicy overrides the backoff policy used for GitHub release/asset fetches. Tests can
+// use this to shrink delays and attempt counts.
+func WithRetryPolicy(policy RetryPolicy) APIOption {
+	return func(a *apiImpl) {
+		a.retryPolicy = policy
+	}
 }
 
 // NewAPI returns an API implementation for the given context.
-func NewAPI(ctx context.Context) API {
-	return apiImpl{
-		ctx: ctx,
+func NewAPI(ctx context.Context, opts ...APIOption) API {
+	a := apiImpl{
+		ctx:         ctx,
+		retryPolicy: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(&a)
 	}
+	return a
 }
 
 // GetManifestForSHA loads the (gzipped) contents of the manifest JSON for the release associated
-// with the given SHA, if any.
+// with the given SHA, if any, from the upstream web-platform-tests/wpt repo.
 func (a apiImpl) GetManifestForSHA(sha string) (fetchedSHA string, manifest []byte, err error) {
+	return a.GetManifestForSHAFromRepo(shared.WPTRepoOwner, shared.WPTRepoName, sha)
+}
+
+// GetManifestForSHAFromRepo loads the (gzipped) contents of the manifest JSON for the release
+// associated with the given SHA in owner/repo, if any. It checks the Redis cache first, which is
+// populated by both prior GitHub fetches and directly-ingested manifests (see IngestManifest),
+// before falling back to GitHub. Concurrent calls for the same owner/repo/SHA are coalesced so
+// that only one fetch hits GitHub; all callers receive the same bytes.
+func (a apiImpl) GetManifestForSHAFromRepo(owner, repo, sha string) (fetchedSHA string, manifest []byte, err error) {
+	cacheKey := cacheKeyForRepoSHA(owner, repo, sha)
+	cache := a.NewRedis(manifestCacheExpiry)
+	if data, cacheErr := cache.Read(cacheKey); cacheErr == nil && len(data) > 0 {
+		return sha, data, nil
+	}
+
 	aeAPI := shared.NewAppEngineAPI(a.ctx)
-	fetchedSHA, body, err := getGitHubReleaseAssetForSHA(aeAPI, sha)
+	fetched, err := coalesce(cacheKey, func() (manifestFetchResult, error) {
+		fetchedSHA, body, err := getGitHubReleaseAssetForSHA(aeAPI, owner, repo, sha, a.retryPolicy)
+		if err != nil {
+			return manifestFetchResult{fetchedSHA: fetchedSHA}, err
+		}
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return manifestFetchResult{fetchedSHA: fetchedSHA}, err
+		}
+		return manifestFetchResult{fetchedSHA: fetchedSHA, data: data}, nil
+	})
+	if err == nil && len(fetched.data) > 0 {
+		_ = cache.Write(cacheKeyForRepoSHA(owner, repo, fetched.fetchedSHA), fetched.data)
+	}
+	return fetched.fetchedSHA, fetched.data, err
+}
+
+// coalesce runs fn under fetchGroup, so that concurrent calls sharing the same key invoke fn at
+// most once and all receive its result.
+func coalesce(key string, fn func() (manifestFetchResult, error)) (manifestFetchResult, error) {
+	result, err, _ := fetchGroup.Do(key, func() (interface{}, error) {
+		return fn()
+	})
+	return result.(manifestFetchResult), err
+}
+
+// IngestManifest validates that sha has the shape of a git SHA and that gzBytes is a gzipped,
+// well-formed JSON document, then stores it in the Redis cache, bypassing the GitHub release
+// lookup. This lets an external workflow step push a manifest as soon as a wpt commit lands,
+// rather than waiting on GitHub's release/search latency.
+//
+// Note: a wpt manifest's JSON body doesn't embed the commit SHA it was generated for, so there is
+// no payload content to cross-check sha against; sha is trusted from the caller, which is gated
+// by the upload bearer token (see HandleUpload).
+func (a apiImpl) IngestManifest(sha string, gzBytes []byte) error {
+	return a.IngestManifestForRepo(shared.WPTRepoOwner, shared.WPTRepoName, sha, gzBytes)
+}
+
+// IngestManifestForRepo validates and stores gzBytes under the cache key for owner/repo/sha,
+// bypassing the GitHub release lookup. See API.IngestManifestForRepo.
+func (a apiImpl) IngestManifestForRepo(owner, repo, sha string, gzBytes []byte) error {
+	if _, err := validateManifestPayload(sha, gzBytes); err != nil {
+		return err
+	}
+	return a.NewRedis(manifestCacheExpiry).Write(cacheKeyForRepoSHA(owner, repo, sha), gzBytes)
+}
+
+// validateManifestPayload checks that sha has the shape of a git SHA and that gzBytes gunzips to
+// well-formed JSON, returning the decompressed bytes.
+func validateManifestPayload(sha string, gzBytes []byte) ([]byte, error) {
+	if !shaRegex.MatchString(sha) {
+		return nil, fmt.Errorf("invalid SHA %q", sha)
+	}
+	gzReader, err := gzip.NewReader(bytes.NewReader(gzBytes))
 	if err != nil {
-		return fetchedSHA, nil, err
+		return nil, fmt.Errorf("payload is not gzipped: %w", err)
 	}
-	data, err := ioutil.ReadAll(body)
+	defer gzReader.Close()
+	data, err := ioutil.ReadAll(gzReader)
 	if err != nil {
-		return fetchedSHA, nil, err
+		return nil, fmt.Errorf("error reading gzipped payload: %w", err)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("payload does not contain a valid manifest JSON for SHA %s", sha)
 	}
-	return fetchedSHA, data, err
+	return data, nil
 }
 
-// getGitHubReleaseAssetForSHA gets the bytes for the SHA's release's manifest json gzip asset.
-// This is done using a few hops on the GitHub API, so should be cached afterward.
-func getGitHubReleaseAssetForSHA(aeAPI shared.AppEngineAPI, sha string) (fetchedSHA string, manifest io.Reader, err error) {
-	client, err := aeAPI.GetGitHubClient()
+// cacheKeyForSHA is the Redis key used for both GitHub-sourced and directly-ingested manifests
+// of the upstream web-platform-tests/wpt repo.
+func cacheKeyForSHA(sha string) string {
+	return cacheKeyForRepoSHA(shared.WPTRepoOwner, shared.WPTRepoName, sha)
+}
+
+// cacheKeyForRepoSHA is the Redis key used for manifests of the given owner/repo. It preserves
+// the pre-existing, unprefixed key format for the upstream repo so caches populated before
+// cross-repo support was added keep hitting.
+func cacheKeyForRepoSHA(owner, repo, sha string) string {
+	if owner == shared.WPTRepoOwner && repo == shared.WPTRepoName {
+		return fmt.Sprintf("MANIFEST-%s.json.gz", sha)
+	}
+	return fmt.Sprintf("%s/%s/MANIFEST-%s.json.gz", owner, repo, sha)
+}
+
+// manifestFetchResult is the value shared by all callers coalesced onto the same
+// singleflight.Group.Do call in GetManifestForSHA.
+type manifestFetchResult struct {
+	fetchedSHA string
+	data       []byte
+}
+
+// getGitHubReleaseAssetForSHA gets the bytes for the SHA's release's manifest json gzip asset in
+// owner/repo. This is done using a few hops on the GitHub API, so should be cached afterward.
+// Each hop is retried per policy, short-circuiting on HTTP 404 instead of burning retries on a
+// release that genuinely doesn't exist yet (e.g. an in-flight PR SHA).
+func getGitHubReleaseAssetForSHA(aeAPI shared.AppEngineAPI, owner, repo, sha string, policy RetryPolicy) (fetchedSHA string, manifest io.Reader, err error) {
+	release, releaseTag, err := resolveReleaseForSHA(aeAPI, owner, repo, sha, policy)
 	if err != nil {
 		return "", nil, err
 	}
-	var release *github.RepositoryRelease
-	releaseTag := "latest"
+	return downloadManifestAsset(aeAPI, release, releaseTag, policy)
+}
+
+// resolveReleaseForSHA finds the GitHub release associated with the given SHA in owner/repo,
+// without downloading any of its assets.
+func resolveReleaseForSHA(aeAPI shared.AppEngineAPI, owner, repo, sha string, policy RetryPolicy) (release *github.RepositoryRelease, releaseTag string, err error) {
+	client, err := aeAPI.GetGitHubClient()
+	if err != nil {
+		return nil, "", err
+	}
+	releaseTag = "latest"
 	if shared.IsLatest(sha) {
 		// Use GitHub's API for latest release.
-		release, _, err = client.Repositories.GetLatestRelease(aeAPI.Context(), shared.WPTRepoOwner, shared.WPTRepoName)
+		err = policy.retry(func() (err error) {
+			release, _, err = client.Repositories.GetLatestRelease(aeAPI.Context(), owner, repo)
+			return err
+		})
 	} else {
-		q := fmt.Sprintf("SHA:%s repo:web-platform-tests/wpt", sha)
-		issues, _, err := client.Search.Issues(aeAPI.Context(), q, nil)
+		q := fmt.Sprintf("SHA:%s repo:%s/%s", sha, owner, repo)
+		var issues *github.IssuesSearchResult
+		err = policy.retry(func() (err error) {
+			issues, _, err = client.Search.Issues(aeAPI.Context(), q, nil)
+			return err
+		})
 		if err != nil {
-			return "", nil, err
+			return nil, "", err
 		}
 		if issues == nil || len(issues.Issues) < 1 {
-			return "", nil, fmt.Errorf("No search results found for SHA %s", sha)
+			return nil, "", fmt.Errorf("No search results found for SHA %s", sha)
 		}
 
 		releaseTag = fmt.Sprintf("merge_pr_%d", issues.Issues[0].GetNumber())
-		release, _, err = client.Repositories.GetReleaseByTag(aeAPI.Context(), shared.WPTRepoOwner, shared.WPTRepoName, releaseTag)
+		err = policy.retry(func() (err error) {
+			release, _, err = client.Repositories.GetReleaseByTag(aeAPI.Context(), owner, repo, releaseTag)
+			return err
+		})
 	}
-
 	if err != nil {
-		return "", nil, err
-	} else if release == nil || len(release.Assets) < 1 {
+		return nil, releaseTag, err
+	}
+	return release, releaseTag, nil
+}
+
+// downloadManifestAsset finds and downloads the "MANIFEST-{sha}.json.gz" asset on release.
+func downloadManifestAsset(aeAPI shared.AppEngineAPI, release *github.RepositoryRelease, releaseTag string, policy RetryPolicy) (fetchedSHA string, manifest io.Reader, err error) {
+	if release == nil || len(release.Assets) < 1 {
 		return "", nil, fmt.Errorf("No assets found for %s release", releaseTag)
 	}
 	// Get (and unzip) the asset with name "MANIFEST-{sha}.json.gz"
@@ -92,19 +269,53 @@ func getGitHubReleaseAssetForSHA(aeAPI shared.AppEngineAPI, sha string) (fetched
 		if matches := AssetRegex.FindStringSubmatch(name); matches != nil {
 			fetchedSHA = matches[1]
 			url = asset.GetBrowserDownloadURL()
-
-			client := aeAPI.GetHTTPClient()
-			resp, err := client.Get(url)
-			if err != nil {
-				return fetchedSHA, nil, err
-			}
-			return fetchedSHA, resp.Body, err
+			body, err := downloadAsset(aeAPI, url, policy)
+			return fetchedSHA, body, err
 		}
 	}
 	return "", nil, fmt.Errorf("No manifest asset found for release %s", releaseTag)
 }
 
-// NewRedis creates a new redisReadWritable with the given duration.
+// downloadAsset GETs a release asset's browser download URL, retrying per policy and
+// short-circuiting to ErrManifestNotFound on HTTP 404.
+func downloadAsset(aeAPI shared.AppEngineAPI, url string, policy RetryPolicy) (body io.Reader, err error) {
+	return downloadAssetWithClient(aeAPI.GetHTTPClient(), url, policy)
+}
+
+// downloadAssetWithClient does the work of downloadAsset given an *http.Client directly, rather
+// than through shared.AppEngineAPI, so its HTTP-status classification (200 vs 404 vs anything
+// else) can be exercised against an httptest.Server in tests without a real AppEngine context.
+func downloadAssetWithClient(httpClient *http.Client, url string, policy RetryPolicy) (body io.Reader, err error) {
+	var resp *http.Response
+	err = policy.retry(func() error {
+		resp, err = httpClient.Get(url)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return ErrManifestNotFound
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("asset fetch returned status %s", resp.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// NewRedis creates a new redis-backed ReadWritable with the given duration. When the
+// environment is configured for a Redis Cluster (REDIS_MODE=cluster, with seed nodes in
+// REDIS_ADDRS), manifest caching is sharded across the cluster instead of a single node. The
+// cluster client is implemented entirely within this package (see rediscluster.go) rather than
+// through shared.AppEngineAPI, since the shared package doesn't expose cluster config yet.
 func (a apiImpl) NewRedis(duration time.Duration) shared.ReadWritable {
+	if addrs := redisClusterAddrsFromEnv(); len(addrs) > 0 {
+		return newRedisClusterReadWritable(a.ctx, addrs, duration)
+	}
 	return shared.NewRedisReadWritable(a.ctx, duration)
 }
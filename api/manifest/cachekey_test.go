@@ -0,0 +1,33 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"testing"
+
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+func TestCacheKeyForRepoSHA_upstreamRepoKeepsUnprefixedKey(t *testing.T) {
+	got := cacheKeyForRepoSHA(shared.WPTRepoOwner, shared.WPTRepoName, validSHA)
+	want := "MANIFEST-" + validSHA + ".json.gz"
+	if got != want {
+		t.Errorf("cacheKeyForRepoSHA(upstream) = %q, want %q", got, want)
+	}
+	if got != cacheKeyForSHA(validSHA) {
+		t.Errorf("cacheKeyForRepoSHA(upstream) = %q, want to match cacheKeyForSHA = %q", got, cacheKeyForSHA(validSHA))
+	}
+}
+
+func TestCacheKeyForRepoSHA_forkIsPrefixedAndDistinct(t *testing.T) {
+	got := cacheKeyForRepoSHA("servo", "wpt", validSHA)
+	want := "servo/wpt/MANIFEST-" + validSHA + ".json.gz"
+	if got != want {
+		t.Errorf("cacheKeyForRepoSHA(fork) = %q, want %q", got, want)
+	}
+	if got == cacheKeyForSHA(validSHA) {
+		t.Errorf("fork cache key collided with upstream cache key: %q", got)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesce_concurrentCallsShareOneFetch(t *testing.T) {
+	const waiters = 5
+	var calls int32
+	var entered sync.WaitGroup
+	entered.Add(waiters)
+	release := make(chan struct{})
+
+	fn := func() (manifestFetchResult, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		// Give any not-yet-scheduled callers a chance to reach coalesce and join this call,
+		// rather than racing to start a second one once this call completes.
+		time.Sleep(10 * time.Millisecond)
+		return manifestFetchResult{fetchedSHA: "abc", data: []byte("manifest-bytes")}, nil
+	}
+
+	results := make([]manifestFetchResult, waiters)
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entered.Done()
+			result, err := coalesce("same-key", fn)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			results[i] = result
+		}(i)
+	}
+
+	// All callers have at least reached the line before coalesce.
+	entered.Wait()
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("fn called %d times, want 1", got)
+	}
+	for i, result := range results {
+		if result.fetchedSHA != "abc" || string(result.data) != "manifest-bytes" {
+			t.Errorf("results[%d] = %+v, want shared fetch result", i, result)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloadAssetWithClient_retries5xxThenSucceeds(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("manifest-bytes"))
+	}))
+	defer server.Close()
+
+	body, err := downloadAssetWithClient(server.Client(), server.URL, testRetryPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+	if string(data) != "manifest-bytes" {
+		t.Errorf("body = %q, want %q", data, "manifest-bytes")
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("requests = %d, want 2 (one 500, one 200)", got)
+	}
+}
+
+func TestDownloadAssetWithClient_404ShortCircuitsAsManifestNotFound(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := downloadAssetWithClient(server.Client(), server.URL, testRetryPolicy)
+	if !errors.Is(err, ErrManifestNotFound) {
+		t.Fatalf("err = %v, want ErrManifestNotFound", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests = %d, want 1 (no retries on 404)", got)
+	}
+}
+
+func TestDownloadAssetWithClient_persistent5xxGivesUpAfterMaxAttempts(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	_, err := downloadAssetWithClient(server.Client(), server.URL, testRetryPolicy)
+	if err == nil {
+		t.Fatal("expected an error for a persistent 502, got nil")
+	}
+	if got := atomic.LoadInt32(&requests); got != int32(testRetryPolicy.MaxAttempts) {
+		t.Errorf("requests = %d, want %d", got, testRetryPolicy.MaxAttempts)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// uploadTokenSecretName is the secret-manager entry holding the shared token that authorizes
+// direct manifest ingestion (e.g. from a wpt-consumer-style workflow step).
+const uploadTokenSecretName = "manifest-upload-token"
+
+// HandleUpload handles POST /api/manifest/upload, accepting a pre-fetched, gzipped
+// MANIFEST-{sha}.json.gz body for the SHA given in the "sha" query parameter. The optional
+// "owner" and "repo" query parameters ingest the manifest for a fork/branch instead of upstream
+// web-platform-tests/wpt; both must be given together, or neither. It requires a bearer token
+// matching the secret-manager-backed upload token.
+func HandleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	aeAPI := shared.NewAppEngineAPI(ctx)
+	token, err := aeAPI.GetSecret(uploadTokenSecretName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("upload token is not configured: %v", err), http.StatusUnauthorized)
+		return
+	}
+	if err := checkBearerToken(r, token); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sha := r.URL.Query().Get("sha")
+	if sha == "" {
+		http.Error(w, "Missing sha parameter", http.StatusBadRequest)
+		return
+	}
+	owner, repo := r.URL.Query().Get("owner"), r.URL.Query().Get("repo")
+	if (owner == "") != (repo == "") {
+		http.Error(w, "owner and repo must be given together, or neither", http.StatusBadRequest)
+		return
+	}
+	if owner == "" {
+		owner, repo = shared.WPTRepoOwner, shared.WPTRepoName
+	}
+
+	gzBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading request body: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := NewAPI(ctx).IngestManifestForRepo(owner, repo, sha, gzBytes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// checkBearerToken checks the request's "Authorization: Bearer <token>" header against want in
+// constant time.
+func checkBearerToken(r *http.Request, want string) error {
+	given := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(given) <= len(prefix) || given[:len(prefix)] != prefix {
+		return fmt.Errorf("missing or malformed Authorization header")
+	}
+	given = given[len(prefix):]
+	if subtle.ConstantTimeCompare([]byte(given), []byte(want)) != 1 {
+		return fmt.Errorf("invalid upload token")
+	}
+	return nil
+}
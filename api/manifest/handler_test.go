@@ -0,0 +1,48 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newRequestWithAuth(t *testing.T, authHeader string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/api/manifest/upload?sha="+validSHA, nil)
+	if authHeader != "" {
+		r.Header.Set("Authorization", authHeader)
+	}
+	return r
+}
+
+func TestCheckBearerToken_valid(t *testing.T) {
+	r := newRequestWithAuth(t, "Bearer correct-token")
+	if err := checkBearerToken(r, "correct-token"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckBearerToken_missingHeader(t *testing.T) {
+	r := newRequestWithAuth(t, "")
+	if err := checkBearerToken(r, "correct-token"); err == nil {
+		t.Error("expected an error for a missing Authorization header, got nil")
+	}
+}
+
+func TestCheckBearerToken_wrongScheme(t *testing.T) {
+	r := newRequestWithAuth(t, "Basic correct-token")
+	if err := checkBearerToken(r, "correct-token"); err == nil {
+		t.Error("expected an error for a non-Bearer scheme, got nil")
+	}
+}
+
+func TestCheckBearerToken_wrongToken(t *testing.T) {
+	r := newRequestWithAuth(t, "Bearer wrong-token")
+	if err := checkBearerToken(r, "correct-token"); err == nil {
+		t.Error("expected an error for a mismatched token, got nil")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte(s)); err != nil {
+		t.Fatalf("gzip.Write: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("gzip.Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+const validSHA = "1111111111111111111111111111111111111111"
+
+func TestValidateManifestPayload_valid(t *testing.T) {
+	data, err := validateManifestPayload(validSHA, gzipBytes(t, `{"items":{}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != `{"items":{}}` {
+		t.Errorf("data = %q, want the decompressed JSON", data)
+	}
+}
+
+func TestValidateManifestPayload_invalidSHAShape(t *testing.T) {
+	if _, err := validateManifestPayload("not-a-sha", gzipBytes(t, `{}`)); err == nil {
+		t.Error("expected an error for a malformed SHA, got nil")
+	}
+}
+
+func TestValidateManifestPayload_notGzipped(t *testing.T) {
+	if _, err := validateManifestPayload(validSHA, []byte(`{"items":{}}`)); err == nil {
+		t.Error("expected an error for a non-gzipped payload, got nil")
+	}
+}
+
+func TestValidateManifestPayload_invalidJSON(t *testing.T) {
+	if _, err := validateManifestPayload(validSHA, gzipBytes(t, `not json`)); err == nil {
+		t.Error("expected an error for invalid JSON, got nil")
+	}
+}
+
+func TestValidateManifestPayload_truncatedGzipStreamSurfacesReadError(t *testing.T) {
+	full := gzipBytes(t, strings.Repeat(`{"items":{}}`, 100))
+	truncated := full[:len(full)-4]
+
+	_, err := validateManifestPayload(validSHA, truncated)
+	if err == nil {
+		t.Fatal("expected an error for a truncated gzip stream, got nil")
+	}
+	if strings.Contains(err.Error(), "valid manifest JSON") {
+		t.Errorf("err = %q, want a gzip read error distinct from the generic invalid-JSON message", err.Error())
+	}
+}
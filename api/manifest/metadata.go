@@ -0,0 +1,152 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/google/go-github/v47/github"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// metadataAssetName is the release asset describing the manifest's schema, analogous to a
+// clusterctl metadata.yaml describing which contract versions a release supports.
+const metadataAssetName = "metadata.json"
+
+// legacySchemaVersion is assumed for releases published before metadata.json existed, so old
+// manifests remain reachable by callers whose compatible range includes it.
+const legacySchemaVersion = 0
+
+// releaseListPageSize bounds how many recent releases GetCompatibleManifestForSHA walks looking
+// for a compatible one.
+const releaseListPageSize = 30
+
+// ErrNoCompatibleManifest is returned when no recent release's manifest schema falls within the
+// caller's requested [minSchema, maxSchema] range.
+var ErrNoCompatibleManifest = errors.New("manifest: no release with a compatible manifest schema found")
+
+// ManifestMetadata describes the schema version and supported test types of a manifest release
+// asset, so that consumers can safely evolve past manifest schema bumps without requiring a
+// coordinated deploy.
+type ManifestMetadata struct {
+	SchemaVersion      int      `json:"schema_version"`
+	SupportedTestTypes []string `json:"supported_test_types"`
+}
+
+// GetCompatibleManifestForSHA loads the manifest for sha's release if its metadata.json declares
+// a schema version within [minSchema, maxSchema]. Otherwise, it walks recent releases from newest
+// to oldest and returns the manifest of the first one that is compatible, so that old wpt.fyi
+// instances can skip a manifest with an unsupported schema instead of crashing on unknown fields.
+// The same fallback applies if sha's own release can't be resolved at all (a 404, e.g. for an
+// in-flight PR SHA with no release yet): any other resolution error is propagated as-is, since
+// that's something genuinely wrong (e.g. a GitHub API outage), not a case to paper over.
+func (a apiImpl) GetCompatibleManifestForSHA(sha string, minSchema, maxSchema int) (fetchedSHA string, manifest []byte, err error) {
+	aeAPI := shared.NewAppEngineAPI(a.ctx)
+	owner, repo := shared.WPTRepoOwner, shared.WPTRepoName
+
+	release, releaseTag, resolveErr := resolveReleaseForSHA(aeAPI, owner, repo, sha, a.retryPolicy)
+	if resolveErr != nil && !isNotFoundErr(resolveErr) {
+		return "", nil, resolveErr
+	}
+
+	var meta *ManifestMetadata
+	var metaErr error
+	if resolveErr == nil {
+		meta, metaErr = fetchReleaseMetadata(aeAPI, release, a.retryPolicy)
+	}
+	if ownReleaseIsUsable(resolveErr, meta, metaErr, minSchema, maxSchema) {
+		fetchedSHA, body, err := downloadManifestAsset(aeAPI, release, releaseTag, a.retryPolicy)
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := ioutil.ReadAll(body)
+		return fetchedSHA, data, err
+	}
+
+	client, err := aeAPI.GetGitHubClient()
+	if err != nil {
+		return "", nil, err
+	}
+	var releases []*github.RepositoryRelease
+	err = a.retryPolicy.retry(func() (err error) {
+		releases, _, err = client.Repositories.ListReleases(aeAPI.Context(), owner, repo, &github.ListOptions{PerPage: releaseListPageSize})
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	candidate, err := pickCompatibleRelease(releases, minSchema, maxSchema, func(r *github.RepositoryRelease) (*ManifestMetadata, error) {
+		return fetchReleaseMetadata(aeAPI, r, a.retryPolicy)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	fetchedSHA, body, err := downloadManifestAsset(aeAPI, candidate, candidate.GetTagName(), a.retryPolicy)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := ioutil.ReadAll(body)
+	return fetchedSHA, data, err
+}
+
+// pickCompatibleRelease walks releases from newest to oldest (the order GitHub's ListReleases
+// returns them in) and returns the first one whose metadata (per metaFn) falls within
+// [minSchema, maxSchema]. Releases whose metadata can't be fetched are skipped, not treated as a
+// hard failure, so one broken release doesn't block negotiation against older ones. (A legacy
+// release without metadata.json is not an error: fetchReleaseMetadata reports it as
+// legacySchemaVersion.)
+func pickCompatibleRelease(releases []*github.RepositoryRelease, minSchema, maxSchema int, metaFn func(*github.RepositoryRelease) (*ManifestMetadata, error)) (*github.RepositoryRelease, error) {
+	for _, candidate := range releases {
+		meta, err := metaFn(candidate)
+		if err != nil || !schemaInRange(meta, minSchema, maxSchema) {
+			continue
+		}
+		return candidate, nil
+	}
+	return nil, ErrNoCompatibleManifest
+}
+
+// schemaInRange reports whether meta's schema version falls within [minSchema, maxSchema].
+func schemaInRange(meta *ManifestMetadata, minSchema, maxSchema int) bool {
+	return meta != nil && meta.SchemaVersion >= minSchema && meta.SchemaVersion <= maxSchema
+}
+
+// ownReleaseIsUsable reports whether GetCompatibleManifestForSHA should use sha's own release
+// directly, rather than falling back to walking recent releases: it must have resolved at all
+// (resolveErr nil), its metadata must have been fetched successfully (metaErr nil), and that
+// metadata's schema version must fall within [minSchema, maxSchema].
+func ownReleaseIsUsable(resolveErr error, meta *ManifestMetadata, metaErr error, minSchema, maxSchema int) bool {
+	return resolveErr == nil && metaErr == nil && schemaInRange(meta, minSchema, maxSchema)
+}
+
+// fetchReleaseMetadata downloads and parses release's metadata.json asset. Releases published
+// before metadata.json existed are treated as legacySchemaVersion.
+func fetchReleaseMetadata(aeAPI shared.AppEngineAPI, release *github.RepositoryRelease, policy RetryPolicy) (*ManifestMetadata, error) {
+	if release == nil {
+		return nil, fmt.Errorf("no release to fetch metadata for")
+	}
+	for _, asset := range release.Assets {
+		if asset.GetName() != metadataAssetName {
+			continue
+		}
+		body, err := downloadAsset(aeAPI, asset.GetBrowserDownloadURL(), policy)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		var meta ManifestMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, err
+		}
+		return &meta, nil
+	}
+	return &ManifestMetadata{SchemaVersion: legacySchemaVersion}, nil
+}
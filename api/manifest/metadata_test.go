@@ -0,0 +1,118 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-github/v47/github"
+)
+
+func TestSchemaInRange(t *testing.T) {
+	tests := []struct {
+		name                 string
+		meta                 *ManifestMetadata
+		minSchema, maxSchema int
+		want                 bool
+	}{
+		{"nil metadata", nil, 0, 5, false},
+		{"below range", &ManifestMetadata{SchemaVersion: 1}, 2, 5, false},
+		{"above range", &ManifestMetadata{SchemaVersion: 6}, 2, 5, false},
+		{"at lower bound", &ManifestMetadata{SchemaVersion: 2}, 2, 5, true},
+		{"at upper bound", &ManifestMetadata{SchemaVersion: 5}, 2, 5, true},
+		{"in range", &ManifestMetadata{SchemaVersion: 3}, 2, 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schemaInRange(tt.meta, tt.minSchema, tt.maxSchema); got != tt.want {
+				t.Errorf("schemaInRange(%v, %d, %d) = %v, want %v", tt.meta, tt.minSchema, tt.maxSchema, got, tt.want)
+			}
+		})
+	}
+}
+
+func releaseWithTag(tag string) *github.RepositoryRelease {
+	return &github.RepositoryRelease{TagName: github.String(tag)}
+}
+
+func TestPickCompatibleRelease_picksFirstCompatible(t *testing.T) {
+	releases := []*github.RepositoryRelease{
+		releaseWithTag("newest"),
+		releaseWithTag("middle"),
+		releaseWithTag("oldest"),
+	}
+	metas := map[string]*ManifestMetadata{
+		"newest": {SchemaVersion: 3},
+		"middle": {SchemaVersion: 1},
+		"oldest": {SchemaVersion: 1},
+	}
+	got, err := pickCompatibleRelease(releases, 0, 1, func(r *github.RepositoryRelease) (*ManifestMetadata, error) {
+		return metas[r.GetTagName()], nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.GetTagName() != "middle" {
+		t.Errorf("got tag %q, want %q (newest incompatible, middle is the first compatible)", got.GetTagName(), "middle")
+	}
+}
+
+func TestPickCompatibleRelease_skipsReleaseWithMetadataError(t *testing.T) {
+	releases := []*github.RepositoryRelease{
+		releaseWithTag("broken"),
+		releaseWithTag("ok"),
+	}
+	got, err := pickCompatibleRelease(releases, 0, 5, func(r *github.RepositoryRelease) (*ManifestMetadata, error) {
+		if r.GetTagName() == "broken" {
+			return nil, errors.New("metadata.json download failed")
+		}
+		return &ManifestMetadata{SchemaVersion: 1}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.GetTagName() != "ok" {
+		t.Errorf("got tag %q, want %q", got.GetTagName(), "ok")
+	}
+}
+
+func TestPickCompatibleRelease_noneCompatible(t *testing.T) {
+	releases := []*github.RepositoryRelease{releaseWithTag("only")}
+	_, err := pickCompatibleRelease(releases, 0, 1, func(r *github.RepositoryRelease) (*ManifestMetadata, error) {
+		return &ManifestMetadata{SchemaVersion: 9}, nil
+	})
+	if !errors.Is(err, ErrNoCompatibleManifest) {
+		t.Errorf("err = %v, want ErrNoCompatibleManifest", err)
+	}
+}
+
+func TestOwnReleaseIsUsable(t *testing.T) {
+	resolveErr404 := ErrManifestNotFound
+	genuineErr := errors.New("github is down")
+	compatible := &ManifestMetadata{SchemaVersion: 2}
+	incompatible := &ManifestMetadata{SchemaVersion: 9}
+
+	tests := []struct {
+		name                 string
+		resolveErr, metaErr  error
+		meta                 *ManifestMetadata
+		minSchema, maxSchema int
+		want                 bool
+	}{
+		{"resolved and compatible", nil, nil, compatible, 0, 5, true},
+		{"resolved but incompatible schema falls back", nil, nil, incompatible, 0, 5, false},
+		{"resolved but metadata fetch failed falls back", nil, errors.New("metadata.json download failed"), nil, 0, 5, false},
+		{"unresolvable sha (404, e.g. in-flight PR) falls back", resolveErr404, nil, nil, 0, 5, false},
+		{"genuine resolve error is not usable either", genuineErr, nil, nil, 0, 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownReleaseIsUsable(tt.resolveErr, tt.meta, tt.metaErr, tt.minSchema, tt.maxSchema); got != tt.want {
+				t.Errorf("ownReleaseIsUsable(...) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// redisClusterAddrsFromEnv returns the seed node addresses for a Redis Cluster, as configured by
+// REDIS_MODE=cluster and a comma-separated REDIS_ADDRS (e.g. "host1:6379,host2:6379"). It returns
+// nil when cluster mode isn't configured, so NewRedis falls back to the single-node path.
+func redisClusterAddrsFromEnv() []string {
+	if os.Getenv("REDIS_MODE") != "cluster" {
+		return nil
+	}
+	raw := os.Getenv("REDIS_ADDRS")
+	if raw == "" {
+		return nil
+	}
+	var addrs []string
+	for _, addr := range strings.Split(raw, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// redisClusterReadWritable is a shared.ReadWritable backed by a Redis Cluster client, sharding
+// manifest cache entries across the given seed nodes (and following MOVED/ASK redirection, which
+// go-redis's ClusterClient handles transparently).
+type redisClusterReadWritable struct {
+	ctx    context.Context
+	client *redis.ClusterClient
+	expiry time.Duration
+}
+
+// newRedisClusterReadWritable creates a redisClusterReadWritable seeded with addrs, reusing a
+// shared *redis.ClusterClient (and its per-node connection pools) across calls with the same
+// addrs rather than dialing a fresh one per request (see sharedClusterClient).
+func newRedisClusterReadWritable(ctx context.Context, addrs []string, expiry time.Duration) shared.ReadWritable {
+	return &redisClusterReadWritable{
+		ctx:    ctx,
+		client: sharedClusterClient(addrs),
+		expiry: expiry,
+	}
+}
+
+var (
+	clusterClientsMu sync.Mutex
+	clusterClients   = map[string]*redis.ClusterClient{}
+)
+
+// sharedClusterClient returns a memoized *redis.ClusterClient for addrs, creating one on first
+// use. NewRedis is called once per manifest fetch/ingest request, so without memoizing here each
+// request would dial a brand-new connection pool per cluster node, defeating the point of
+// horizontally scaling the cache across nodes.
+func sharedClusterClient(addrs []string) *redis.ClusterClient {
+	key := strings.Join(addrs, ",")
+
+	clusterClientsMu.Lock()
+	defer clusterClientsMu.Unlock()
+	if client, ok := clusterClients[key]; ok {
+		return client
+	}
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: addrs})
+	clusterClients[key] = client
+	return client
+}
+
+// Read implements shared.ReadWritable.
+func (r *redisClusterReadWritable) Read(id string) ([]byte, error) {
+	return r.client.Get(r.ctx, id).Bytes()
+}
+
+// Write implements shared.ReadWritable.
+func (r *redisClusterReadWritable) Write(id string, value []byte) error {
+	return r.client.Set(r.ctx, id, value, r.expiry).Err()
+}
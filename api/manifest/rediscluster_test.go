@@ -0,0 +1,54 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import "testing"
+
+func TestRedisClusterAddrsFromEnv_disabledByDefault(t *testing.T) {
+	if addrs := redisClusterAddrsFromEnv(); addrs != nil {
+		t.Errorf("expected nil addrs with no REDIS_MODE set, got %v", addrs)
+	}
+}
+
+func TestRedisClusterAddrsFromEnv_singleNodeModeIgnored(t *testing.T) {
+	t.Setenv("REDIS_MODE", "single")
+	t.Setenv("REDIS_ADDRS", "host1:6379")
+	if addrs := redisClusterAddrsFromEnv(); addrs != nil {
+		t.Errorf("expected nil addrs when REDIS_MODE != cluster, got %v", addrs)
+	}
+}
+
+func TestRedisClusterAddrsFromEnv_clusterMode(t *testing.T) {
+	t.Setenv("REDIS_MODE", "cluster")
+	t.Setenv("REDIS_ADDRS", "host1:6379, host2:6379,host3:6379")
+
+	addrs := redisClusterAddrsFromEnv()
+	want := []string{"host1:6379", "host2:6379", "host3:6379"}
+	if len(addrs) != len(want) {
+		t.Fatalf("got %v, want %v", addrs, want)
+	}
+	for i, addr := range want {
+		if addrs[i] != addr {
+			t.Errorf("addrs[%d] = %q, want %q", i, addrs[i], addr)
+		}
+	}
+}
+
+func TestSharedClusterClient_memoizesBySameAddrs(t *testing.T) {
+	addrs := []string{"memo-host1:6379", "memo-host2:6379"}
+	first := sharedClusterClient(addrs)
+	second := sharedClusterClient(addrs)
+	if first != second {
+		t.Errorf("sharedClusterClient returned distinct clients for the same addrs, want the same *redis.ClusterClient reused")
+	}
+}
+
+func TestSharedClusterClient_distinctAddrsGetDistinctClients(t *testing.T) {
+	a := sharedClusterClient([]string{"memo-distinct-a:6379"})
+	b := sharedClusterClient([]string{"memo-distinct-b:6379"})
+	if a == b {
+		t.Errorf("sharedClusterClient returned the same client for different addrs")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v47/github"
+)
+
+// ErrManifestNotFound is returned when a release, search, or asset lookup definitively
+// resolves to HTTP 404, meaning no manifest exists yet for the requested SHA. Callers should
+// treat this as "not found" rather than retrying.
+var ErrManifestNotFound = errors.New("manifest: no release or asset found for SHA")
+
+// RetryPolicy controls the exponential backoff used when fetching releases and assets from
+// GitHub. It short-circuits on HTTP 404 (see ErrManifestNotFound) instead of retrying, since a
+// release for an in-flight PR SHA may simply not exist yet.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first, before giving up.
+	MaxAttempts int
+	// BaseDelay is the backoff delay before the first retry; it doubles after each subsequent
+	// attempt. Each actual sleep is jittered to a random duration between half the backoff delay
+	// and the full backoff delay.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay between attempts.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by NewAPI unless overridden via WithRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    4 * time.Second,
+}
+
+// retry calls fn until it succeeds, fn's error is deemed a 404 (in which case retry returns
+// ErrManifestNotFound immediately), or the policy's attempts are exhausted.
+func (p RetryPolicy) retry(fn func() error) error {
+	delay := p.BaseDelay
+	var err error
+	for attempt := 0; attempt < p.MaxAttempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if isNotFoundErr(err) {
+			return ErrManifestNotFound
+		}
+		if attempt == p.MaxAttempts-1 {
+			break
+		}
+		time.Sleep(delay/2 + time.Duration(rand.Int63n(int64(delay/2+1))))
+		if delay *= 2; delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+	return err
+}
+
+// isNotFoundErr reports whether err wraps a GitHub API 404 response, or is already
+// ErrManifestNotFound (e.g. surfaced by a raw HTTP asset download).
+func isNotFoundErr(err error) bool {
+	if errors.Is(err, ErrManifestNotFound) {
+		return true
+	}
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) {
+		return ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 The WPT Dashboard Project. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v47/github"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    4 * time.Millisecond,
+}
+
+func TestRetryPolicy_succeedsFirstTry(t *testing.T) {
+	calls := 0
+	err := testRetryPolicy.retry(func() error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryPolicy_retriesTransientErrorsThenSucceeds(t *testing.T) {
+	calls := 0
+	err := testRetryPolicy.retry(func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("transient 5xx")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestRetryPolicy_givesUpAfterMaxAttempts(t *testing.T) {
+	calls := 0
+	wantErr := errors.New("persistent 5xx")
+	err := testRetryPolicy.retry(func() error {
+		calls++
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("err = %v, want %v", err, wantErr)
+	}
+	if calls != testRetryPolicy.MaxAttempts {
+		t.Errorf("calls = %d, want %d", calls, testRetryPolicy.MaxAttempts)
+	}
+}
+
+func TestRetryPolicy_shortCircuitsOn404(t *testing.T) {
+	calls := 0
+	err := testRetryPolicy.retry(func() error {
+		calls++
+		return ErrManifestNotFound
+	})
+	if !errors.Is(err, ErrManifestNotFound) {
+		t.Fatalf("err = %v, want ErrManifestNotFound", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 (no retries on 404)", calls)
+	}
+}
+
+func TestIsNotFoundErr(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"ErrManifestNotFound itself", ErrManifestNotFound, true},
+		{"wrapped ErrManifestNotFound", fmt.Errorf("fetching asset: %w", ErrManifestNotFound), true},
+		{"github 404 ErrorResponse", &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}, true},
+		{"github 500 ErrorResponse", &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusInternalServerError}}, false},
+		{"generic error", errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNotFoundErr(tt.err); got != tt.want {
+				t.Errorf("isNotFoundErr(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}